@@ -0,0 +1,70 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Info contains temporary info to execute a REST call, or show the results
+// of an already completed REST call.
+type Info struct {
+	Client    RESTClient
+	Mapping   *meta.RESTMapping
+	Namespace string
+	Name      string
+
+	// Cluster identifies the cluster this Info was fetched from. It is only
+	// set by multi-cluster Visitors such as MultiClusterSelector, and is
+	// empty for single-cluster Visit calls.
+	Cluster string
+
+	// Optional, Source is the filename or URL to template file (.json or .yaml),
+	// or stdin to use to handle the resource
+	Source string
+
+	// Optional, this is the most recent value returned by the server if this
+	// object was retrieved from the server.
+	ResourceVersion string
+
+	// Optional, this record is threaded through the operation to track the
+	// most recent value observed from the server for this object.
+	Object runtime.Object
+}
+
+// String returns the general purpose string representation
+func (i *Info) String() string {
+	basicInfo := fmt.Sprintf("Name: %q, Namespace: %q", i.Name, i.Namespace)
+	if i.Cluster != "" {
+		basicInfo = fmt.Sprintf("Cluster: %q, %s", i.Cluster, basicInfo)
+	}
+	if i.Mapping != nil {
+		basicInfo = fmt.Sprintf("Resource: %q, %s", i.Mapping.Resource, basicInfo)
+	}
+	if i.Object != nil {
+		basicInfo = fmt.Sprintf("%s, Object: %T", basicInfo, i.Object)
+	}
+	return basicInfo
+}
+
+// Visit implements Visitor
+func (i *Info) Visit(fn VisitorFunc) error {
+	return fn(i, nil)
+}
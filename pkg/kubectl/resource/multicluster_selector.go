@@ -0,0 +1,297 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"fmt"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// ClusterClient identifies a single cluster a MultiClusterSelector should
+// fan a List/Watch out to.
+type ClusterClient struct {
+	// Name identifies the cluster and is stamped onto every Info this
+	// cluster produces, so downstream printers/patches can route back.
+	Name    string
+	Client  RESTClient
+	Mapping *meta.RESTMapping
+}
+
+// MultiClusterSelector is a Visitor that fans the same GVR out across
+// multiple clusters, tagging each emitted Info with the cluster it came
+// from. It is the multi-cluster analog of Selector.
+type MultiClusterSelector struct {
+	Clusters             []ClusterClient
+	Namespace            string
+	Selector             string
+	Export               bool
+	IncludeUninitialized bool
+	LimitChunks          int64
+
+	// Concurrency bounds how many clusters are listed at once. Defaults to
+	// len(Clusters) (i.e. unbounded across clusters) when <= 0.
+	Concurrency int
+
+	// FieldSelector, ResourceVersion, ResourceVersionMatch, TimeoutSeconds,
+	// Accept and Transform are threaded straight through to each
+	// per-cluster Selector; see Selector for their semantics.
+	FieldSelector        string
+	ResourceVersion      string
+	ResourceVersionMatch metav1.ResourceVersionMatch
+	TimeoutSeconds       *int64
+	Accept               string
+	Transform            func(runtime.Object) (runtime.Object, error)
+
+	// OnExpiredContinue, MaxRestartAttempts and Deduplicate are threaded
+	// straight through to each per-cluster Selector; see Selector for their
+	// semantics. Restarts and deduplication are tracked independently per
+	// cluster, since continue tokens and UIDs aren't comparable across them.
+	OnExpiredContinue  OnExpiredContinuePolicy
+	MaxRestartAttempts int
+	Deduplicate        bool
+
+	// PerItem is threaded straight through to each per-cluster Selector;
+	// see Selector.PerItem.
+	PerItem bool
+	// PerClusterConcurrency is threaded through as each per-cluster
+	// Selector's own Concurrency, bounding how many workers process that
+	// one cluster's pages. It is independent of Concurrency above, which
+	// bounds how many clusters run at once.
+	PerClusterConcurrency int
+}
+
+// NewMultiClusterSelector creates a Visitor that lists/watches the same
+// resource across the given clusters concurrently.
+func NewMultiClusterSelector(clusters []ClusterClient, namespace, selector string, export, includeUninitialized bool, limitChunks int64) *MultiClusterSelector {
+	return &MultiClusterSelector{
+		Clusters:             clusters,
+		Namespace:            namespace,
+		Selector:             selector,
+		Export:               export,
+		IncludeUninitialized: includeUninitialized,
+		LimitChunks:          limitChunks,
+	}
+}
+
+// Visit implements Visitor, running a chunked Selector.Visit per cluster
+// through a bounded worker pool. Infos are tagged with their originating
+// cluster before being handed to fn. The first error returned by fn or by
+// any cluster's List stops that cluster's iteration; other clusters keep
+// running to completion, and the first error observed is returned,
+// prefixed with the name of the cluster it came from.
+func (m *MultiClusterSelector) Visit(fn VisitorFunc) error {
+	if len(m.Clusters) == 0 {
+		return nil
+	}
+	concurrency := m.Concurrency
+	if concurrency <= 0 || concurrency > len(m.Clusters) {
+		concurrency = len(m.Clusters)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		sem      = make(chan struct{}, concurrency)
+		errOnce  sync.Once
+		firstErr error
+	)
+	for i := range m.Clusters {
+		cc := m.Clusters[i]
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			selector := &Selector{
+				Client:               cc.Client,
+				Mapping:              cc.Mapping,
+				Namespace:            m.Namespace,
+				Selector:             m.Selector,
+				Export:               m.Export,
+				IncludeUninitialized: m.IncludeUninitialized,
+				LimitChunks:          m.LimitChunks,
+
+				FieldSelector:        m.FieldSelector,
+				ResourceVersion:      m.ResourceVersion,
+				ResourceVersionMatch: m.ResourceVersionMatch,
+				TimeoutSeconds:       m.TimeoutSeconds,
+				Accept:               m.Accept,
+				Transform:            m.Transform,
+
+				OnExpiredContinue:  m.OnExpiredContinue,
+				MaxRestartAttempts: m.MaxRestartAttempts,
+				Deduplicate:        m.Deduplicate,
+
+				PerItem:     m.PerItem,
+				Concurrency: m.PerClusterConcurrency,
+			}
+			err := selector.Visit(func(info *Info, err error) error {
+				if err == nil {
+					info.Cluster = cc.Name
+				}
+				return fn(info, err)
+			})
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = fmt.Errorf("cluster %q: %v", cc.Name, err)
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// Watch multiplexes a per-cluster watch.Interface into a single channel.
+// When a cluster's watch fails with IsResourceExpired, only that cluster's
+// watch is reopened, from the last resourceVersion that cluster's watch
+// delivered (or resourceVersion, if it delivered none); the others are
+// left undisturbed.
+func (m *MultiClusterSelector) Watch(resourceVersion string) (watch.Interface, error) {
+	mux := &multiClusterWatch{
+		result: make(chan watch.Event),
+		stopCh: make(chan struct{}),
+	}
+	for i := range m.Clusters {
+		cc := m.Clusters[i]
+		mux.wg.Add(1)
+		go mux.run(cc, m.Namespace, m.Selector, resourceVersion)
+	}
+	return mux, nil
+}
+
+// multiClusterWatch fans the ResultChan of several per-cluster watches into
+// a single channel, reconnecting individual clusters on resource expiry.
+type multiClusterWatch struct {
+	result chan watch.Event
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+func (m *multiClusterWatch) run(cc ClusterClient, namespace, selector, resourceVersion string) {
+	defer m.wg.Done()
+	rv := resourceVersion
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		default:
+		}
+		w, err := m.connect(cc, namespace, selector, rv)
+		if w == nil {
+			if err != nil {
+				m.emitError(cc.Name, err)
+			}
+			return
+		}
+		reconnect := m.forward(w, &rv)
+		if !reconnect {
+			return
+		}
+	}
+}
+
+// connect calls Watch in the background so that a concurrent Stop can
+// return promptly even though the per-cluster Watch call itself has no way
+// to be canceled. It returns (nil, nil) if stopCh closes before Watch
+// returns; the abandoned watch, if one eventually arrives, is stopped once
+// it does rather than being leaked.
+func (m *multiClusterWatch) connect(cc ClusterClient, namespace, selector, resourceVersion string) (watch.Interface, error) {
+	return raceAgainstStop(m.stopCh, func() (watch.Interface, error) {
+		return NewHelper(cc.Client, cc.Mapping).Watch(namespace, resourceVersion, cc.Mapping.GroupVersionKind.GroupVersion().String(), selector)
+	})
+}
+
+// raceAgainstStop runs connectFn in the background and returns what it
+// returns, unless stopCh closes first - in which case it returns (nil, nil)
+// immediately and, once connectFn eventually does return, stops the watch
+// instead of leaking it.
+func raceAgainstStop(stopCh <-chan struct{}, connectFn func() (watch.Interface, error)) (watch.Interface, error) {
+	type result struct {
+		w   watch.Interface
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		w, err := connectFn()
+		done <- result{w, err}
+	}()
+	select {
+	case r := <-done:
+		return r.w, r.err
+	case <-stopCh:
+		go func() {
+			if r := <-done; r.w != nil {
+				r.w.Stop()
+			}
+		}()
+		return nil, nil
+	}
+}
+
+// forward copies events from w to the shared result channel, tracking the
+// most recently observed resourceVersion. It returns true if the watch
+// closed because the continue token/resourceVersion expired and the caller
+// should reopen a fresh watch for this cluster, false if the mux was
+// stopped or the channel closed for any other reason.
+func (m *multiClusterWatch) forward(w watch.Interface, rv *string) bool {
+	defer w.Stop()
+	for {
+		select {
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return false
+			}
+			if accessor, err := meta.Accessor(event.Object); err == nil && accessor.GetResourceVersion() != "" {
+				*rv = accessor.GetResourceVersion()
+			}
+			if event.Type == watch.Error && errors.IsResourceExpired(errors.FromObject(event.Object)) {
+				return true
+			}
+			select {
+			case m.result <- event:
+			case <-m.stopCh:
+				return false
+			}
+		case <-m.stopCh:
+			return false
+		}
+	}
+}
+
+func (m *multiClusterWatch) emitError(cluster string, err error) {
+	status := errors.NewInternalError(fmt.Errorf("cluster %q: %v", cluster, err)).Status()
+	select {
+	case m.result <- watch.Event{Type: watch.Error, Object: &status}:
+	case <-m.stopCh:
+	}
+}
+
+func (m *multiClusterWatch) ResultChan() <-chan watch.Event {
+	return m.result
+}
+
+func (m *multiClusterWatch) Stop() {
+	close(m.stopCh)
+	m.wg.Wait()
+}
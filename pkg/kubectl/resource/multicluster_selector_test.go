@@ -0,0 +1,174 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	stderrors "errors"
+	"testing"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// fakeWatch is a minimal watch.Interface backed by a channel the test
+// controls directly.
+type fakeWatch struct {
+	ch      chan watch.Event
+	stopped chan struct{}
+}
+
+func newFakeWatch() *fakeWatch {
+	return &fakeWatch{ch: make(chan watch.Event, 1), stopped: make(chan struct{})}
+}
+
+func (f *fakeWatch) ResultChan() <-chan watch.Event { return f.ch }
+func (f *fakeWatch) Stop()                          { close(f.stopped) }
+
+// fakeObject is the minimal runtime.Object + metav1.Object a generic
+// meta.Accessor can read a resourceVersion from.
+type fakeObject struct {
+	metav1.TypeMeta
+	metav1.ObjectMeta
+}
+
+func (f *fakeObject) DeepCopyObject() runtime.Object {
+	out := *f
+	return &out
+}
+
+func TestMultiClusterWatchForwardReconnectsOnExpiry(t *testing.T) {
+	mux := &multiClusterWatch{result: make(chan watch.Event), stopCh: make(chan struct{})}
+	w := newFakeWatch()
+
+	status := apierrors.NewResourceExpired("continuation expired").Status()
+	w.ch <- watch.Event{Type: watch.Error, Object: &status}
+
+	reconnect := mux.forward(w, new(string))
+	if !reconnect {
+		t.Fatalf("forward() = false, want true so the caller reopens a fresh watch for this cluster")
+	}
+	select {
+	case <-w.stopped:
+	default:
+		t.Fatalf("forward() did not Stop() the expired watch")
+	}
+}
+
+func TestMultiClusterWatchForwardDeliversEventsAndTracksResourceVersion(t *testing.T) {
+	mux := &multiClusterWatch{result: make(chan watch.Event), stopCh: make(chan struct{})}
+	w := newFakeWatch()
+
+	obj := &fakeObject{}
+	obj.ResourceVersion = "42"
+	w.ch <- watch.Event{Type: watch.Added, Object: obj}
+	close(w.ch)
+
+	rv := ""
+	done := make(chan bool, 1)
+	go func() { done <- mux.forward(w, &rv) }()
+
+	select {
+	case event := <-mux.result:
+		if event.Type != watch.Added {
+			t.Fatalf("got event type %v, want Added", event.Type)
+		}
+	case reconnect := <-done:
+		t.Fatalf("forward() returned (reconnect=%v) before delivering the buffered event", reconnect)
+	}
+
+	if reconnect := <-done; reconnect {
+		t.Fatalf("forward() = true on a normally closed channel, want false (no reconnect)")
+	}
+	if rv != "42" {
+		t.Fatalf("resourceVersion = %q, want %q", rv, "42")
+	}
+}
+
+func TestRaceAgainstStopReturnsConnectResultWhenFirst(t *testing.T) {
+	stopCh := make(chan struct{})
+	w := newFakeWatch()
+
+	got, err := raceAgainstStop(stopCh, func() (watch.Interface, error) {
+		return w, nil
+	})
+	if err != nil {
+		t.Fatalf("raceAgainstStop returned error: %v", err)
+	}
+	if got != w {
+		t.Fatalf("raceAgainstStop returned %v, want the connectFn's watch", got)
+	}
+}
+
+func TestRaceAgainstStopReturnsPromptlyAndStopsLateWatch(t *testing.T) {
+	stopCh := make(chan struct{})
+	releaseConnect := make(chan struct{})
+	w := newFakeWatch()
+
+	resultCh := make(chan struct {
+		w   watch.Interface
+		err error
+	}, 1)
+	go func() {
+		got, err := raceAgainstStop(stopCh, func() (watch.Interface, error) {
+			<-releaseConnect
+			return w, nil
+		})
+		resultCh <- struct {
+			w   watch.Interface
+			err error
+		}{got, err}
+	}()
+
+	close(stopCh)
+	result := <-resultCh
+	if result.w != nil || result.err != nil {
+		t.Fatalf("raceAgainstStop() = (%v, %v), want (nil, nil) once stopCh is closed", result.w, result.err)
+	}
+
+	select {
+	case <-w.stopped:
+		t.Fatalf("watch was stopped before connectFn returned it")
+	default:
+	}
+	close(releaseConnect)
+	select {
+	case <-w.stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("watch returned after stopCh closed was never Stop()'d")
+	}
+}
+
+func TestMultiClusterWatchEmitErrorTagsClusterName(t *testing.T) {
+	mux := &multiClusterWatch{result: make(chan watch.Event, 1), stopCh: make(chan struct{})}
+
+	mux.emitError("east", stderrors.New("dial tcp: connection refused"))
+
+	event := <-mux.result
+	if event.Type != watch.Error {
+		t.Fatalf("got event type %v, want Error", event.Type)
+	}
+	status, ok := event.Object.(*metav1.Status)
+	if !ok {
+		t.Fatalf("event.Object is %T, want *metav1.Status", event.Object)
+	}
+	if status.Message == "" {
+		t.Fatalf("status.Message is empty, want it to mention the cluster and underlying error")
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"math"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// KindPriority returns a sort key for gvk; Infos with a lower priority are
+// visited (and thus typically created) before Infos with a higher one.
+// Infos with equal priority keep their relative order.
+type KindPriority func(gvk schema.GroupVersionKind) int
+
+// defaultKindOrder mirrors the Kind ordering used by ecosystem installers
+// (e.g. helm's install ordering): namespaces and other cluster-scoped
+// dependencies first, then config and storage, then workloads, then the
+// objects that route traffic to them.
+var defaultKindOrder = []string{
+	"Namespace",
+	"CustomResourceDefinition",
+	"ServiceAccount",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"Role",
+	"RoleBinding",
+	"ConfigMap",
+	"Secret",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"Service",
+	"DaemonSet",
+	"Pod",
+	"ReplicationController",
+	"ReplicaSet",
+	"Deployment",
+	"StatefulSet",
+	"Job",
+	"CronJob",
+	"Ingress",
+	"HorizontalPodAutoscaler",
+}
+
+// DefaultKindPriority ranks gvk using the Kind order most installers rely
+// on. Kinds absent from the table sort after every known kind, so
+// unrecognized CRDs still produce a stable (if arbitrary) order.
+func DefaultKindPriority(gvk schema.GroupVersionKind) int {
+	for i, kind := range defaultKindOrder {
+		if gvk.Kind == kind {
+			return i
+		}
+	}
+	return len(defaultKindOrder)
+}
+
+// KindHinter is implemented by Visitors - such as Selector, via its existing
+// ResourceMapping method - that can report the GroupVersionKind they will
+// emit without being visited. OrderedVisitor uses this to order Visitors
+// relative to each other before streaming any of them.
+type KindHinter interface {
+	ResourceMapping() *meta.RESTMapping
+}
+
+// PagedVisitor is implemented by Visitors - such as Selector, via its
+// existing VisitPages method - that stream results across discrete pages
+// and can signal page boundaries. OrderedVisitor uses this, where
+// available, to flush a bounded per-page buffer instead of buffering a
+// Visitor's entire output before any of it is delivered.
+type PagedVisitor interface {
+	VisitPages(fn VisitorFunc, onPageBoundary func() error) error
+}
+
+// OrderedVisitor wraps a set of Visitors - typically one per resource kind,
+// as produced by a Builder - and reorders the Infos they emit by Kind so
+// that dependencies are visited (and thus created) before the objects that
+// depend on them. Reverse flips the order for teardown.
+//
+// Because each wrapped Visitor may itself stream results across many pages
+// (see Selector), OrderedVisitor establishes the Kind order across Visitors
+// up front - using KindHinter where a Visitor implements it - and then
+// visits them in that order, buffering and flushing one page at a time for
+// any Visitor that also implements PagedVisitor, rather than holding the
+// entire result set in memory. Visitors that don't implement PagedVisitor
+// fall back to buffering their whole output before flushing it. Visitors
+// that don't implement KindHinter sort as the lowest-priority tier, in
+// their original relative order. Set FullSort to ignore KindHinter and
+// instead buffer every Info across every Visitor before flushing, which
+// guarantees a total order even for Visitors that can't be ranked up
+// front, at the cost of memory.
+type OrderedVisitor struct {
+	Visitors []Visitor
+
+	// KindPriority ranks Infos for ordering. Defaults to DefaultKindPriority.
+	KindPriority KindPriority
+	// Reverse visits Infos in the reverse of KindPriority order, for teardown.
+	Reverse bool
+	// FullSort buffers every Info across all Visitors before flushing any
+	// of them, instead of ordering Visitors by KindHinter and sorting each
+	// page (or each non-paged Visitor's whole output) on its own.
+	FullSort bool
+}
+
+// NewOrderedVisitor wraps visitors with the default Kind ordering.
+func NewOrderedVisitor(visitors ...Visitor) *OrderedVisitor {
+	return &OrderedVisitor{Visitors: visitors, KindPriority: DefaultKindPriority}
+}
+
+func (v *OrderedVisitor) priority() KindPriority {
+	if v.KindPriority != nil {
+		return v.KindPriority
+	}
+	return DefaultKindPriority
+}
+
+// Visit implements Visitor.
+func (v *OrderedVisitor) Visit(fn VisitorFunc) error {
+	priority := v.priority()
+
+	if v.FullSort {
+		var buf []*Info
+		for _, visitor := range v.Visitors {
+			if err := visitor.Visit(collectInto(&buf, fn)); err != nil {
+				return err
+			}
+		}
+		return flushOrdered(buf, priority, v.Reverse, fn)
+	}
+
+	visitors := sortVisitorsByKind(v.Visitors, priority, v.Reverse)
+	for _, visitor := range visitors {
+		if paged, ok := visitor.(PagedVisitor); ok {
+			if err := visitPaged(paged, priority, v.Reverse, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		var page []*Info
+		if err := visitor.Visit(collectInto(&page, fn)); err != nil {
+			return err
+		}
+		if err := flushOrdered(page, priority, v.Reverse, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// visitPaged drives a PagedVisitor, flushing the Infos of each page in
+// Kind order as soon as that page arrives instead of waiting for the whole
+// Visitor to finish.
+func visitPaged(visitor PagedVisitor, priority KindPriority, reverse bool, fn VisitorFunc) error {
+	var page []*Info
+	return visitor.VisitPages(collectInto(&page, fn), func() error {
+		err := flushOrdered(page, priority, reverse, fn)
+		page = page[:0]
+		return err
+	})
+}
+
+// collectInto returns a VisitorFunc that buffers successfully visited Infos
+// into buf, while passing errors straight through to fn so failures surface
+// immediately instead of being held until a flush.
+func collectInto(buf *[]*Info, fn VisitorFunc) VisitorFunc {
+	return func(info *Info, err error) error {
+		if err != nil {
+			return fn(info, err)
+		}
+		*buf = append(*buf, info)
+		return nil
+	}
+}
+
+func flushOrdered(infos []*Info, priority KindPriority, reverse bool, fn VisitorFunc) error {
+	sort.SliceStable(infos, func(i, j int) bool {
+		pi, pj := priority(infos[i].Mapping.GroupVersionKind), priority(infos[j].Mapping.GroupVersionKind)
+		if reverse {
+			return pi > pj
+		}
+		return pi < pj
+	})
+	for _, info := range infos {
+		if err := fn(info, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortVisitorsByKind orders visitors by the priority of their hinted Kind,
+// stably among Visitors of equal priority - including any that don't
+// implement KindHinter, which rank as the lowest-priority tier.
+func sortVisitorsByKind(visitors []Visitor, priority KindPriority, reverse bool) []Visitor {
+	sorted := make([]Visitor, len(visitors))
+	copy(sorted, visitors)
+	rank := func(visitor Visitor) int {
+		hinter, ok := visitor.(KindHinter)
+		if !ok {
+			return math.MaxInt32
+		}
+		return priority(hinter.ResourceMapping().GroupVersionKind)
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := rank(sorted[i]), rank(sorted[j])
+		if reverse {
+			return ri > rj
+		}
+		return ri < rj
+	})
+	return sorted
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// fakeKindVisitor is a Visitor that also implements KindHinter, emulating
+// how Selector exposes its GroupVersionKind via ResourceMapping without
+// being visited.
+type fakeKindVisitor struct {
+	kind string
+	name string
+}
+
+func (f *fakeKindVisitor) mapping() *meta.RESTMapping {
+	return &meta.RESTMapping{GroupVersionKind: schema.GroupVersionKind{Kind: f.kind}}
+}
+
+func (f *fakeKindVisitor) ResourceMapping() *meta.RESTMapping {
+	return f.mapping()
+}
+
+func (f *fakeKindVisitor) Visit(fn VisitorFunc) error {
+	return fn(&Info{Mapping: f.mapping(), Name: f.name}, nil)
+}
+
+func TestOrderedVisitorDefaultModeOrdersAcrossVisitors(t *testing.T) {
+	// Discovery order is arbitrary/wrong: Deployment before its Namespace.
+	deployment := &fakeKindVisitor{kind: "Deployment", name: "app"}
+	namespace := &fakeKindVisitor{kind: "Namespace", name: "app-ns"}
+
+	var order []string
+	ov := NewOrderedVisitor(deployment, namespace)
+	if err := ov.Visit(func(info *Info, err error) error {
+		if err != nil {
+			return err
+		}
+		order = append(order, info.Name)
+		return nil
+	}); err != nil {
+		t.Fatalf("Visit returned error: %v", err)
+	}
+
+	if len(order) != 2 || order[0] != "app-ns" || order[1] != "app" {
+		t.Fatalf("got order %v, want [app-ns app] (Namespace before Deployment)", order)
+	}
+}
+
+// fakePagedKindVisitor is a Visitor that also implements KindHinter and
+// PagedVisitor, emulating Selector.VisitPages: it delivers its Infos across
+// several pages and records, via onPage, how many Infos had been delivered
+// by the time each page boundary fired.
+type fakePagedKindVisitor struct {
+	kind  string
+	pages [][]string
+
+	delivered int
+	flushedAt []int
+}
+
+func (f *fakePagedKindVisitor) mapping() *meta.RESTMapping {
+	return &meta.RESTMapping{GroupVersionKind: schema.GroupVersionKind{Kind: f.kind}}
+}
+
+func (f *fakePagedKindVisitor) ResourceMapping() *meta.RESTMapping {
+	return f.mapping()
+}
+
+func (f *fakePagedKindVisitor) Visit(fn VisitorFunc) error {
+	return f.VisitPages(fn, nil)
+}
+
+func (f *fakePagedKindVisitor) VisitPages(fn VisitorFunc, onPageBoundary func() error) error {
+	for _, page := range f.pages {
+		for _, name := range page {
+			if err := fn(&Info{Mapping: f.mapping(), Name: name}, nil); err != nil {
+				return err
+			}
+			f.delivered++
+		}
+		if onPageBoundary != nil {
+			f.flushedAt = append(f.flushedAt, f.delivered)
+			if err := onPageBoundary(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func TestOrderedVisitorFlushesEachPageRatherThanBufferingTheWholeVisitor(t *testing.T) {
+	pods := &fakePagedKindVisitor{kind: "Pod", pages: [][]string{{"pod-1", "pod-2"}, {"pod-3"}}}
+
+	var order []string
+	ov := NewOrderedVisitor(pods)
+	if err := ov.Visit(func(info *Info, err error) error {
+		if err != nil {
+			return err
+		}
+		order = append(order, info.Name)
+		return nil
+	}); err != nil {
+		t.Fatalf("Visit returned error: %v", err)
+	}
+
+	if want := []string{"pod-1", "pod-2", "pod-3"}; len(order) != len(want) {
+		t.Fatalf("got order %v, want %v", order, want)
+	}
+	// The whole point of paged flushing is that a page is flushed as soon
+	// as it arrives, not after the Visitor's entire output has streamed.
+	if want := []int{2, 3}; len(pods.flushedAt) != len(want) || pods.flushedAt[0] != want[0] || pods.flushedAt[1] != want[1] {
+		t.Fatalf("flushedAt = %v, want %v (first page flushed before the second page is fetched)", pods.flushedAt, want)
+	}
+}
+
+func TestOrderedVisitorReverseOrdersTeardownLastFirst(t *testing.T) {
+	deployment := &fakeKindVisitor{kind: "Deployment", name: "app"}
+	namespace := &fakeKindVisitor{kind: "Namespace", name: "app-ns"}
+
+	var order []string
+	ov := NewOrderedVisitor(namespace, deployment)
+	ov.Reverse = true
+	if err := ov.Visit(func(info *Info, err error) error {
+		if err != nil {
+			return err
+		}
+		order = append(order, info.Name)
+		return nil
+	}); err != nil {
+		t.Fatalf("Visit returned error: %v", err)
+	}
+
+	if len(order) != 2 || order[0] != "app" || order[1] != "app-ns" {
+		t.Fatalf("got order %v, want [app app-ns] (Deployment before Namespace on teardown)", order)
+	}
+}
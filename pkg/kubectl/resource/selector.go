@@ -17,14 +17,36 @@ limitations under the License.
 package resource
 
 import (
+	"context"
 	"fmt"
+	"sync"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/watch"
 )
 
+// OnExpiredContinuePolicy controls how Visit reacts when the chunked list's
+// continue token expires mid-pagination, which on large clusters is
+// typically caused by etcd compaction racing a long-running list.
+type OnExpiredContinuePolicy int
+
+const (
+	// OnExpiredContinueFail returns the IsResourceExpired error immediately.
+	// This is the zero value and preserves Visit's historical behavior.
+	OnExpiredContinueFail OnExpiredContinuePolicy = iota
+	// OnExpiredContinueRestartFromBeginning clears the continue token and
+	// restarts the chunked list from the first page.
+	OnExpiredContinueRestartFromBeginning
+	// OnExpiredContinueRestartFromResourceVersion restarts the chunked list
+	// from the last resourceVersion observed before the expiry, rather than
+	// from the very beginning.
+	OnExpiredContinueRestartFromResourceVersion
+)
+
 // Selector is a Visitor for resources that match a label selector.
 type Selector struct {
 	Client               RESTClient
@@ -34,6 +56,47 @@ type Selector struct {
 	Export               bool
 	IncludeUninitialized bool
 	LimitChunks          int64
+
+	// OnExpiredContinue controls what Visit does when the continue token
+	// expires mid-pagination. Defaults to OnExpiredContinueFail.
+	OnExpiredContinue OnExpiredContinuePolicy
+	// MaxRestartAttempts bounds how many times Visit will restart the list
+	// in response to OnExpiredContinue. Zero means unbounded.
+	MaxRestartAttempts int
+	// Deduplicate, when true, tracks the UIDs of items already handed to
+	// the VisitorFunc and skips re-emitting them, which matters once a
+	// restart replays pages the caller has already seen.
+	Deduplicate bool
+
+	// FieldSelector restricts the list to objects matching the given field
+	// selector, mirroring `kubectl get --field-selector`.
+	FieldSelector string
+	// ResourceVersion bounds the initial list to a specific resourceVersion.
+	// Combined with ResourceVersionMatch it supports the consistent-read
+	// semantics described for metav1.ListOptions.
+	ResourceVersion string
+	// ResourceVersionMatch qualifies how ResourceVersion is interpreted.
+	ResourceVersionMatch metav1.ResourceVersionMatch
+	// TimeoutSeconds is passed as metav1.ListOptions.TimeoutSeconds on each
+	// List call made by Visit. Watch does not use it.
+	TimeoutSeconds *int64
+
+	// Accept, if set, overrides the content type requested from the
+	// server, e.g. "application/json;as=PartialObjectMetadataList;v=v1;g=meta.k8s.io"
+	// for a metadata-only listing of very large collections.
+	Accept string
+	// Transform, when set, runs on each page's list object before it is
+	// handed to the VisitorFunc, e.g. to project the object or drop fields
+	// such as managedFields.
+	Transform func(runtime.Object) (runtime.Object, error)
+
+	// Concurrency, when > 1, dispatches Infos to a bounded pool of that
+	// many workers while the pager keeps fetching subsequent pages,
+	// instead of blocking the next List call on the VisitorFunc.
+	Concurrency int
+	// PerItem, when true, splits each page's list into one Info per item
+	// before dispatch, so fn sees individual objects rather than a List.
+	PerItem bool
 }
 
 // NewSelector creates a resource selector which hides details of getting items by their label selector.
@@ -51,21 +114,144 @@ func NewSelector(client RESTClient, mapping *meta.RESTMapping, namespace string,
 
 // Visit implements Visitor and uses request chunking by default.
 func (r *Selector) Visit(fn VisitorFunc) error {
+	return r.VisitWithContext(context.Background(), fn)
+}
+
+// VisitWithContext is like Visit, but accepts a context that is canceled as
+// soon as fn returns an error, so that Concurrency > 1 can stop outstanding
+// workers and the pager promptly instead of running them to completion.
+func (r *Selector) VisitWithContext(ctx context.Context, fn VisitorFunc) error {
+	if r.Concurrency > 1 {
+		return r.visitConcurrent(ctx, fn)
+	}
+	return r.visitPages(ctx, func(info *Info) error {
+		return fn(info, nil)
+	}, nil)
+}
+
+// VisitPages is like Visit, but calls onPageBoundary once per page of
+// results - after that page's Infos have all been delivered to fn and
+// before the next page, if any, is fetched. Callers such as OrderedVisitor
+// use this to flush a bounded per-page buffer instead of holding every Info
+// a Visitor will ever emit in memory. Concurrency is ignored here, since
+// concurrent dispatch does not preserve page boundaries.
+func (r *Selector) VisitPages(fn VisitorFunc, onPageBoundary func() error) error {
+	return r.visitPages(context.Background(), func(info *Info) error {
+		return fn(info, nil)
+	}, onPageBoundary)
+}
+
+// visitConcurrent dispatches Infos from visitPages to a bounded pool of
+// r.Concurrency workers while the pager keeps fetching subsequent pages.
+func (r *Selector) visitConcurrent(ctx context.Context, fn VisitorFunc) error {
+	return dispatchConcurrent(ctx, r.Concurrency, func(ctx context.Context, deliver func(*Info) error) error {
+		return r.visitPages(ctx, deliver, nil)
+	}, fn)
+}
+
+// dispatchConcurrent feeds the Infos that page produces to a bounded pool
+// of concurrency workers running fn, while page keeps fetching subsequent
+// pages rather than blocking on the workers.
+//
+// The first error returned by a worker's fn call cancels ctx, which stops
+// both the other workers and page; that error is returned once everything
+// has drained. If ctx is instead canceled for a reason unrelated to a
+// worker's error - e.g. the caller's own timeout on the ctx passed in -
+// that cancellation is propagated as an error rather than reported as
+// success, since not all Infos were necessarily delivered.
+func dispatchConcurrent(ctx context.Context, concurrency int, page func(context.Context, func(*Info) error) error, fn VisitorFunc) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	infos := make(chan *Info)
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var workerErr error
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case info, ok := <-infos:
+					if !ok {
+						return
+					}
+					if err := fn(info, nil); err != nil {
+						errOnce.Do(func() {
+							workerErr = err
+							cancel()
+						})
+						return
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	pagerErr := page(ctx, func(info *Info) error {
+		select {
+		case infos <- info:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+	close(infos)
+	wg.Wait()
+
+	if workerErr != nil {
+		return workerErr
+	}
+	return pagerErr
+}
+
+// visitPages walks the chunked list (honoring OnExpiredContinue,
+// Deduplicate, Transform and PerItem), calling deliver once per resulting
+// Info and, if onPage is non-nil, once more after each page's Infos have
+// all been delivered and before the next page (if any) is fetched. It
+// stops as soon as ctx is done, or deliver or onPage returns an error, and
+// returns that error.
+func (r *Selector) visitPages(ctx context.Context, deliver func(*Info) error, onPage func() error) error {
 	var continueToken string
+	listResourceVersion := r.ResourceVersion // also reset here to replay a RestartFromResourceVersion
+	var lastResourceVersion string
+	var seen map[types.UID]struct{}
+	if r.Deduplicate {
+		seen = make(map[types.UID]struct{})
+	}
+	attempts := 0
 	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
 		list, err := NewHelper(r.Client, r.Mapping).List(
 			r.Namespace,
 			r.ResourceMapping().GroupVersionKind.GroupVersion().String(),
 			r.Export,
-			&metav1.ListOptions{
-				LabelSelector:        r.Selector,
-				IncludeUninitialized: r.IncludeUninitialized,
-				Limit:                r.LimitChunks,
-				Continue:             continueToken,
-			},
+			r.listOptions(continueToken, listResourceVersion),
+			r.Accept,
 		)
+		listResourceVersion = ""
 		if err != nil {
 			if errors.IsResourceExpired(err) {
+				switch r.OnExpiredContinue {
+				case OnExpiredContinueRestartFromBeginning, OnExpiredContinueRestartFromResourceVersion:
+					if r.MaxRestartAttempts > 0 && attempts >= r.MaxRestartAttempts {
+						return fmt.Errorf("exceeded %d restart attempts for %q after the list continuation expired: %v", r.MaxRestartAttempts, r.Mapping.Resource, err)
+					}
+					attempts++
+					continueToken = ""
+					if r.OnExpiredContinue == OnExpiredContinueRestartFromResourceVersion {
+						listResourceVersion = lastResourceVersion
+					}
+					continue
+				}
 				return err
 			}
 			if errors.IsBadRequest(err) || errors.IsNotFound(err) {
@@ -88,17 +274,33 @@ func (r *Selector) Visit(fn VisitorFunc) error {
 		accessor := r.Mapping.MetadataAccessor
 		resourceVersion, _ := accessor.ResourceVersion(list)
 		nextContinueToken, _ := accessor.Continue(list)
-		info := &Info{
-			Client:    r.Client,
-			Mapping:   r.Mapping,
-			Namespace: r.Namespace,
-
-			Object:          list,
-			ResourceVersion: resourceVersion,
+		lastResourceVersion = resourceVersion
+		if seen != nil {
+			if err := dedupeList(accessor, list, seen); err != nil {
+				return err
+			}
+		}
+		object := runtime.Object(list)
+		if r.Transform != nil {
+			object, err = r.Transform(object)
+			if err != nil {
+				return err
+			}
 		}
-		if err := fn(info, nil); err != nil {
+		infos, err := r.infosForPage(object, resourceVersion)
+		if err != nil {
 			return err
 		}
+		for _, info := range infos {
+			if err := deliver(info); err != nil {
+				return err
+			}
+		}
+		if onPage != nil {
+			if err := onPage(); err != nil {
+				return err
+			}
+		}
 		if len(nextContinueToken) == 0 {
 			return nil
 		}
@@ -106,6 +308,59 @@ func (r *Selector) Visit(fn VisitorFunc) error {
 	}
 }
 
+// infosForPage turns one page's list object into the Infos that should be
+// delivered to the VisitorFunc: a single Info wrapping the whole list, or
+// with PerItem set, one Info per item so callers can apply/patch/annotate
+// each object independently.
+func (r *Selector) infosForPage(object runtime.Object, resourceVersion string) ([]*Info, error) {
+	if !r.PerItem {
+		return []*Info{{
+			Client:    r.Client,
+			Mapping:   r.Mapping,
+			Namespace: r.Namespace,
+
+			Object:          object,
+			ResourceVersion: resourceVersion,
+		}}, nil
+	}
+	items, err := meta.ExtractList(object)
+	if err != nil {
+		return nil, err
+	}
+	accessor := r.Mapping.MetadataAccessor
+	infos := make([]*Info, 0, len(items))
+	for _, item := range items {
+		name, _ := accessor.Name(item)
+		infos = append(infos, &Info{
+			Client:    r.Client,
+			Mapping:   r.Mapping,
+			Namespace: r.Namespace,
+			Name:      name,
+
+			Object:          item,
+			ResourceVersion: resourceVersion,
+		})
+	}
+	return infos, nil
+}
+
+// listOptions builds the metav1.ListOptions for one page of the chunked
+// list, threading through the label/field selectors and consistent-read
+// options callers set on Selector. continueToken and resourceVersion are
+// passed in explicitly since Visit overrides them across pages and restarts.
+func (r *Selector) listOptions(continueToken, resourceVersion string) *metav1.ListOptions {
+	return &metav1.ListOptions{
+		LabelSelector:        r.Selector,
+		FieldSelector:        r.FieldSelector,
+		IncludeUninitialized: r.IncludeUninitialized,
+		Limit:                r.LimitChunks,
+		Continue:             continueToken,
+		ResourceVersion:      resourceVersion,
+		ResourceVersionMatch: r.ResourceVersionMatch,
+		TimeoutSeconds:       r.TimeoutSeconds,
+	}
+}
+
 func (r *Selector) Watch(resourceVersion string) (watch.Interface, error) {
 	return NewHelper(r.Client, r.Mapping).Watch(r.Namespace, resourceVersion, r.ResourceMapping().GroupVersionKind.GroupVersion().String(), r.Selector)
 }
@@ -114,3 +369,26 @@ func (r *Selector) Watch(resourceVersion string) (watch.Interface, error) {
 func (r *Selector) ResourceMapping() *meta.RESTMapping {
 	return r.Mapping
 }
+
+// dedupeList removes items from list whose UID is already in seen, and
+// records the UIDs of the items that survive. It mutates list in place so
+// the caller's downstream handling is unaffected by deduplication.
+func dedupeList(accessor meta.MetadataAccessor, list runtime.Object, seen map[types.UID]struct{}) error {
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	kept := items[:0]
+	for _, item := range items {
+		uid, err := accessor.UID(item)
+		if err != nil {
+			return err
+		}
+		if _, ok := seen[uid]; ok {
+			continue
+		}
+		seen[uid] = struct{}{}
+		kept = append(kept, item)
+	}
+	return meta.SetList(list, kept)
+}
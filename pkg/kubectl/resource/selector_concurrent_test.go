@@ -0,0 +1,100 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestDispatchConcurrentDeliversAllInfos(t *testing.T) {
+	const n = 50
+	page := func(ctx context.Context, deliver func(*Info) error) error {
+		for i := 0; i < n; i++ {
+			if err := deliver(&Info{Name: fmt.Sprintf("item-%d", i)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	err := dispatchConcurrent(context.Background(), 4, page, func(info *Info, err error) error {
+		mu.Lock()
+		seen[info.Name] = true
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("dispatchConcurrent returned error: %v", err)
+	}
+	if len(seen) != n {
+		t.Fatalf("got %d delivered infos, want %d", len(seen), n)
+	}
+}
+
+func TestDispatchConcurrentReturnsFirstWorkerError(t *testing.T) {
+	wantErr := errors.New("boom")
+	page := func(ctx context.Context, deliver func(*Info) error) error {
+		for i := 0; i < 10; i++ {
+			if err := deliver(&Info{Name: fmt.Sprintf("item-%d", i)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := dispatchConcurrent(context.Background(), 2, page, func(info *Info, err error) error {
+		return wantErr
+	})
+	if err != wantErr {
+		t.Fatalf("got error %v, want %v", err, wantErr)
+	}
+}
+
+// blockingPage simulates a long-running pager (like visitPages) that
+// notices ctx cancellation and returns ctx.Err() instead of nil.
+func blockingPage(started chan struct{}) func(context.Context, func(*Info) error) error {
+	return func(ctx context.Context, deliver func(*Info) error) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+}
+
+func TestDispatchConcurrentPropagatesExternalCancellation(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	resultCh := make(chan error, 1)
+
+	go func() {
+		resultCh <- dispatchConcurrent(parent, 2, blockingPage(started), func(info *Info, err error) error {
+			return nil
+		})
+	}()
+
+	<-started
+	cancelParent()
+
+	if err := <-resultCh; err == nil {
+		t.Fatalf("dispatchConcurrent returned nil after the caller canceled its own context, want a non-nil error")
+	}
+}
@@ -0,0 +1,56 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func newUnstructuredPod(uid types.UID) unstructured.Unstructured {
+	u := unstructured.Unstructured{}
+	u.SetUID(uid)
+	u.SetKind("Pod")
+	u.SetAPIVersion("v1")
+	return u
+}
+
+func TestDedupeListSkipsAlreadySeenUIDs(t *testing.T) {
+	accessor := meta.NewAccessor()
+	list := &unstructured.UnstructuredList{
+		Items: []unstructured.Unstructured{
+			newUnstructuredPod("a"),
+			newUnstructuredPod("b"),
+			newUnstructuredPod("a"), // replayed, e.g. after a RestartFromBeginning
+		},
+	}
+	seen := map[types.UID]struct{}{"a": {}} // "a" was already handed to the VisitorFunc
+
+	if err := dedupeList(accessor, list, seen); err != nil {
+		t.Fatalf("dedupeList returned error: %v", err)
+	}
+
+	if len(list.Items) != 1 || list.Items[0].GetUID() != "b" {
+		t.Fatalf("list.Items = %v, want only the unseen %q item", list.Items, "b")
+	}
+	if _, ok := seen["b"]; !ok {
+		t.Fatalf("seen = %v, want it to also record %q after dedupeList", seen, "b")
+	}
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package resource
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSelectorListOptionsThreadsThroughFilteringAndConsistentRead(t *testing.T) {
+	timeout := int64(30)
+	r := &Selector{
+		Selector:             "app=foo",
+		FieldSelector:        "status.phase=Running",
+		IncludeUninitialized: true,
+		LimitChunks:          500,
+		ResourceVersionMatch: metav1.ResourceVersionMatchNotOlderThan,
+		TimeoutSeconds:       &timeout,
+	}
+
+	opts := r.listOptions("cont-token", "123")
+
+	want := metav1.ListOptions{
+		LabelSelector:        "app=foo",
+		FieldSelector:        "status.phase=Running",
+		IncludeUninitialized: true,
+		Limit:                500,
+		Continue:             "cont-token",
+		ResourceVersion:      "123",
+		ResourceVersionMatch: metav1.ResourceVersionMatchNotOlderThan,
+		TimeoutSeconds:       &timeout,
+	}
+	if opts.LabelSelector != want.LabelSelector ||
+		opts.FieldSelector != want.FieldSelector ||
+		opts.IncludeUninitialized != want.IncludeUninitialized ||
+		opts.Limit != want.Limit ||
+		opts.Continue != want.Continue ||
+		opts.ResourceVersion != want.ResourceVersion ||
+		opts.ResourceVersionMatch != want.ResourceVersionMatch ||
+		opts.TimeoutSeconds != want.TimeoutSeconds {
+		t.Fatalf("listOptions() = %+v, want %+v", opts, want)
+	}
+}